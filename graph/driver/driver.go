@@ -10,6 +10,7 @@
 package driver
 
 import (
+	"context"
 	"errors"
 )
 
@@ -76,6 +77,9 @@ type Conn interface {
 	//Get relationship types.
 	RelationshipTypes() ([]string, error)
 
+	// Prepare returns a prepared statement,bound to this Conn.
+	Prepare(query string) (Stmt, error)
+
 	// Close invalidates and potentially stops any current
 	// prepared statements and transactions,marking this
 	// connection as no longer in use.
@@ -87,6 +91,72 @@ type Conn interface {
 	Close() error
 }
 
+// TxOptions holds transaction options to be passed to Conn.BeginTx.
+type TxOptions struct {
+	// ReadOnly signals to the driver that the transaction will only
+	// read data,which drivers backed by a replica set may use to
+	// route the transaction's traversals off the primary.
+	ReadOnly bool
+}
+
+// Tx is a transaction,as started by a Conn's ConnBeginTx.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// ConnBeginTx is an optional interface that may be implemented by a
+// Conn to start a transaction pinned to that connection.If a Conn
+// does not implement ConnBeginTx,the graph package reports that
+// transactions are unsupported by the driver.
+type ConnBeginTx interface {
+	BeginTx(ctx context.Context, opts TxOptions) (Tx, error)
+}
+
+// Pinger is an optional interface that may be implemented by a Conn to
+// provide a lightweight liveness probe.The graph package uses it
+// opportunistically -- both as DB.PingContext's non-context fallback
+// and when handing a pooled connection back out for reuse -- to catch
+// a connection the server has already dropped before it surfaces as a
+// harder-to-diagnose ErrBadConn mid-operation.A Conn that doesn't
+// implement Pinger is assumed healthy until an operation against it
+// actually fails.
+type Pinger interface {
+	Ping() error
+}
+
+// ConnPingContext is an optional interface that may be implemented by
+// a Conn to check that its connection to the database is still alive,
+// honoring ctx's deadline/cancellation.DB.PingContext prefers this
+// over just reusing a pooled Conn unchecked.
+type ConnPingContext interface {
+	PingContext(ctx context.Context) error
+}
+
+// NodeContext is an optional interface that may be implemented by a
+// Conn to create nodes while honoring ctx.When a Conn does not
+// implement NodeContext,the graph package falls back to CreateNode
+// but still abandons the caller's wait once ctx is done.
+type NodeContext interface {
+	CreateNodeContext(ctx context.Context) (Node, error)
+}
+
+// RelationshipContext is an optional interface that may be
+// implemented by a Conn to create relationships while honoring ctx,
+// mirroring NodeContext.
+type RelationshipContext interface {
+	CreateRelationshipContext(ctx context.Context) (Relationship, error)
+}
+
+// NodePropertiesContext is an optional interface that may be
+// implemented by a Node to fetch its properties while honoring ctx.
+// When a Node does not implement NodePropertiesContext,the graph
+// package falls back to Properties but still abandons the caller's
+// wait once ctx is done.
+type NodePropertiesContext interface {
+	PropertiesContext(ctx context.Context) (map[string]interface{}, error)
+}
+
 type Node interface {
 
 	//SetProperty on node.
@@ -145,9 +215,45 @@ type Relationship interface {
 type Stmt interface {
 	// Close closes the statement.
 	//
-	// As of Go 1.1,a Stmt will not be closed if it's in use
-	// by any queries.
+	// A Stmt in use by outstanding queries will not actually be
+	// closed until those queries finish;the graph package keeps the
+	// underlying Conn,and any Rows still reading from it,alive until
+	// every dependent has released it.
+	Close() error
+
+	// Exec executes a query that doesn't return rows,such as a
+	// mutating Cypher/Gremlin statement.
+	Exec(args []Value) (Result, error)
+
+	// Query executes a query that returns rows.
+	Query(args []Value) (Rows, error)
+}
+
+// Result is the result of a query that doesn't return rows,as from
+// Execer or Stmt.Exec.
+type Result interface {
+	// LastInsertId returns the identifier of the node or relationship
+	// created by the query,if applicable.
+	LastInsertId() (int64, error)
+
+	// RowsAffected returns the number of nodes or relationships
+	// affected by the query.
+	RowsAffected() (int64, error)
+}
+
+// Rows is an iterator over an executed query's result set,able to
+// carry node,relationship,or path Values.
+type Rows interface {
+	// Columns returns the names of the columns.
+	Columns() []string
+
+	// Close closes the rows iterator.
 	Close() error
+
+	// Next populates dest with the next row of data.
+	//
+	// Next should return io.EOF when there are no more rows.
+	Next(dest []Value) error
 }
 
 // Execer is an optional interface that may be implemented by a Conn.
@@ -157,6 +263,7 @@ type Stmt interface {
 //
 //Exec may return ErrSkip.
 type Execer interface {
+	Exec(query string, args []Value) (Result, error)
 }
 
 // Queryer is an Optional interface that may be implemented by a Conn.
@@ -166,4 +273,5 @@ type Execer interface {
 //
 // Query may return ErrSkip.
 type Queryer interface {
+	Query(query string, args []Value) (Rows, error)
 }
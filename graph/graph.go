@@ -2,11 +2,15 @@ package graph
 
 import (
 	//"errors"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/cloudcube/database/graph/driver"
+	"io"
 	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var drivers = make(map[string]driver.Driver)
@@ -14,30 +18,82 @@ var drivers = make(map[string]driver.Driver)
 type DB struct {
 	driver driver.Driver
 	dsn    string
-	mu     sync.Mutex
 
-	freeConn []*driverConn
-	closed   bool
-	dep      map[finalCloser]depSet //stacktrace of last conn's put;debug only
-	lastPut  map[*driverConn]string //zero means defaultMaxIdleConns;negative means 0
-	maxIdle  int
+	mu           sync.Mutex //protects following fields
+	freeConn     []*driverConn
+	connRequests map[uint64]chan connRequest
+	nextRequest  uint64 //next key to use in connRequests
+	numOpen      int
+	// openerCh is used to signal the need for new connections.
+	// a goroutine running connectionOpener() reads on this chan and
+	// maybeOpenNewConnections sends on the chan (one send per needed connection).
+	// It is closed during db.Close(). The close tells the connectionOpener
+	// goroutine to exit.
+	openerCh          chan struct{}
+	closed            bool
+	dep               map[finalCloser]depSet //stacktrace of last conn's put;debug only
+	lastPut           map[*driverConn]string //zero means defaultMaxIdleConns;negative means 0
+	maxIdle           int                    //zero means defaultMaxIdleConns;negative means 0
+	maxOpen           int                    //<=0 means unlimited
+	maxLifetime       time.Duration          //maximum amount of time a connection may be reused
+	maxIdleTime       time.Duration          //maximum amount of time a connection may be idle before being closed
+	cleanerCh         chan struct{}
+	waitCount         int64 //total number of connections waited for
+	maxIdleClosed     int64 //total number of connections closed due to idle count or max idle time
+	maxLifetimeClosed int64 //total number of connections closed due to max conn lifetime limit
+	maxBadConnClosed  int64 //total number of connections closed for failing a Pinger liveness check
+	waitDuration      int64 //total time waited for new connections,accessed atomically
 }
 
 type driverConn struct {
-	db *DB
+	db        *DB
+	createdAt time.Time
 
 	sync.Mutex  //guards following
 	ci          driver.Conn
 	closed      bool
 	finalClosed bool //ci.Close has been called
 	openStmt    map[driver.Stmt]bool
+	bad         bool //set by markBad when an abandoned ctx-canceled call may still be running against ci
 
 	// guarded by db.mu
 	inUse      bool
-	onPut      []func() // code(with db.mu help) run when conn is next returned
-	dbmuClosed bool     // same as closed,but guarded by db.mu,for connIfFree
+	returnedAt time.Time //time the connection was created or returned
+	onPut      []func()  // code(with db.mu help) run when conn is next returned
+	dbmuClosed bool      // same as closed,but guarded by db.mu,for connIfFree
+}
+
+// markBad flags dc as unfit for reuse.It is used when a ctx-canceled
+// operation abandons its wait on dc while the driver call may still be
+// running against it,so the conn must not be handed to another
+// caller once that call eventually returns.
+func (dc *driverConn) markBad() {
+	dc.Lock()
+	dc.bad = true
+	dc.Unlock()
+}
+
+// abandonedCall is used as a dep key -- see addDepLocked/removeDepLocked
+// -- to keep a driverConn from being finalized while a driver call it
+// abandoned via ctx cancellation is still running against it.Without
+// this,markBad's ErrBadConn would let putConn call dc.Close(),whose
+// finalClose nils out dc.ci and calls dc.ci.Close() concurrently with
+// the abandoned goroutine still calling into dc.ci.
+//
+// It has non-zero size so that every new(abandonedCall) is a distinct
+// dep key,even when several abandoned calls overlap on one conn.
+type abandonedCall struct{ _ byte }
+
+// connRequest represents one request for a connection made via conn()
+// and waiting on a free or newly-opened connection.
+type connRequest struct {
+	conn *driverConn
+	err  error
 }
 
+// nowFunc returns the current time;stubbed out in tests.
+var nowFunc = time.Now
+
 // Register makes a database driver available by provided name.
 // If Register is called twice with the same name or if driver is nil,
 // it panics.
@@ -70,53 +126,833 @@ func Open(driverName, dataSourceName string) (*DB, error) {
 		return nil, fmt.Errorf("graph:unknown driver %q (forgotten import?", driverName)
 	}
 	db := &DB{
-		driver:  driveri,
-		dsn:     dataSourceName,
-		lastPut: make(map[*driverConn]string),
+		driver:       driveri,
+		dsn:          dataSourceName,
+		openerCh:     make(chan struct{}, connectionRequestQueueSize),
+		lastPut:      make(map[*driverConn]string),
+		connRequests: make(map[uint64]chan connRequest),
 	}
+	go db.connectionOpener()
 	return db, nil
 }
 
+// Close closes the database,releasing any open resources.
+//
+// It is rare to Close a DB,as the DB handle is meant to be
+// long-lived and shared between many goroutines.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed { //make Close idempotent
+		db.mu.Unlock()
+		return nil
+	}
+	if db.cleanerCh != nil {
+		close(db.cleanerCh)
+	}
+	var err error
+	fns := make([]func() error, 0, len(db.freeConn))
+	for _, dc := range db.freeConn {
+		fns = append(fns, dc.closeDBLocked())
+	}
+	db.freeConn = nil
+	db.closed = true
+	for _, req := range db.connRequests {
+		close(req)
+	}
+	db.mu.Unlock()
+	for _, fn := range fns {
+		err1 := fn()
+		if err1 != nil {
+			err = err1
+		}
+	}
+	close(db.openerCh)
+	return err
+}
+
+const connectionRequestQueueSize = 1000000
+
+// connectionOpener runs in a dedicated goroutine, opening new connections
+// whenever maybeOpenNewConnections sends on db.openerCh.
+func (db *DB) connectionOpener() {
+	for range db.openerCh {
+		db.openNewConnection()
+	}
+}
+
+// openNewConnection opens a new connection and attaches it either to a
+// waiting connRequest or to the idle pool.It is only ever called by
+// connectionOpener,one connection at a time.
+//
+// If neither a waiter nor the idle pool wants dc (e.g.the idle pool
+// filled up while this connection was being opened),dc is discarded
+// through the same dep-removal -> finalClose path every other
+// driverConn teardown goes through,rather than closing dc.ci directly
+// and leaving its self-dep in db.dep to leak for the life of the DB.
+func (db *DB) openNewConnection() {
+	ci, err := db.driver.Open(db.dsn)
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		if err == nil {
+			ci.Close()
+		}
+		return
+	}
+	if err != nil {
+		db.numOpen--
+		db.putConnDBLocked(nil, err)
+		db.maybeOpenNewConnections()
+		db.mu.Unlock()
+		return
+	}
+	dc := &driverConn{
+		db:         db,
+		createdAt:  nowFunc(),
+		returnedAt: nowFunc(),
+		ci:         ci,
+	}
+	db.addDepLocked(dc, dc)
+	dc.inUse = true
+	if db.putConnDBLocked(dc, nil) {
+		db.mu.Unlock()
+		return
+	}
+	//putConnDBLocked didn't want dc;finalClose (via the dep-removal
+	//func below) closes ci and decrements numOpen,so don't duplicate
+	//that here.finalClose locks db.mu itself,so it must run after
+	//we've unlocked.
+	fn := db.removeDepLocked(dc, dc)
+	db.mu.Unlock()
+	fn()
+}
+
+// maybeOpenNewConnections sends on db.openerCh,one send per connection
+// that can usefully be opened to satisfy outstanding connRequests.Must
+// be called with db.mu held.
+func (db *DB) maybeOpenNewConnections() {
+	numRequests := len(db.connRequests)
+	if db.maxOpen > 0 {
+		numCanOpen := db.maxOpen - db.numOpen
+		if numRequests > numCanOpen {
+			numRequests = numCanOpen
+		}
+	}
+	for numRequests > 0 {
+		db.numOpen++ //optimistically
+		numRequests--
+		if db.closed {
+			return
+		}
+		db.openerCh <- struct{}{}
+	}
+}
+
 // Ping verifies a connection to the database is still alive,
 // establishing a connection if necessary.
 func (db *DB) Ping() error {
-	dc, err := db.conn()
+	return db.PingContext(context.Background())
+}
+
+// PingContext verifies a connection to the database is still alive,
+// establishing a connection if necessary,and honors ctx's
+// deadline/cancellation while doing so.
+func (db *DB) PingContext(ctx context.Context) error {
+	dc, err := db.conn(ctx)
 	if err != nil {
 		return err
 	}
-	db.putConn(dc, nil)
-	return nil
+	err = db.pingDC(ctx, dc)
+	db.putConn(dc, err)
+	return err
+}
+
+// pingDC prefers dc.ci's driver.ConnPingContext fast path,falling back
+// to the plain driver.Pinger probe -- honoring ctx the same way
+// createNodeDC does -- when the driver doesn't implement it.A driver
+// that implements neither is assumed alive.
+func (db *DB) pingDC(ctx context.Context, dc *driverConn) error {
+	if pinger, ok := dc.ci.(driver.ConnPingContext); ok {
+		return pinger.PingContext(ctx)
+	}
+	pinger, ok := dc.ci.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+	if ctx.Done() == nil {
+		return pinger.Ping()
+	}
+
+	resCh := make(chan error, 1)
+	dep := new(abandonedCall)
+	db.addDep(dc, dep)
+	go func() {
+		err := pinger.Ping()
+		db.removeDep(dc, dep)
+		resCh <- err
+	}()
+	select {
+	case <-ctx.Done():
+		dc.markBad()
+		return ctx.Err()
+	case err := <-resCh:
+		return err
+	}
+}
+
+var errDBClosed = errors.New("graph:database is closed")
+
+// maxBadConnRetries bounds how many times conn() will transparently
+// discard a pooled connection that fails its liveness check and hand
+// out another one,and,separately,how many times withBadConnRetry will
+// redo a whole operation -- acquiring a fresh conn and retrying --
+// after driver.ErrBadConn from the operation itself,before giving up
+// and surfacing the error.
+const maxBadConnRetries = 2
+
+// conn returns a connection,honoring ctx's deadline/cancellation.A
+// connection popped off the idle pool is health-checked (see
+// driverConn.validate) before being handed out;one that fails is
+// discarded and conn transparently retries,up to maxBadConnRetries
+// times,rather than handing the caller a connection that's already
+// known to be dead.
+func (db *DB) conn(ctx context.Context) (*driverConn, error) {
+	var err error
+	for i := 0; i < maxBadConnRetries; i++ {
+		var dc *driverConn
+		dc, err = db.connOnce(ctx)
+		if err != driver.ErrBadConn {
+			return dc, err
+		}
+	}
+	return db.connOnce(ctx)
 }
 
-func (db *DB) conn() (*driverConn, error) {
+func (db *DB) connOnce(ctx context.Context) (*driverConn, error) {
+	select {
+	default:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
 	db.mu.Lock()
 	if db.closed {
 		db.mu.Unlock()
-		return nil, errors.New("graph:database is closed")
+		return nil, errDBClosed
 	}
-	if n := len(db.freeConn); n > 0 {
-		conn := db.freeConn[n-1]
-		db.freeConn = db.freeConn[:n-1]
+
+	lifetime := db.maxLifetime
+
+	//prefer a free connection,if possible.
+	numFree := len(db.freeConn)
+	if numFree > 0 {
+		conn := db.freeConn[numFree-1]
+		db.freeConn = db.freeConn[:numFree-1]
 		conn.inUse = true
 		db.mu.Unlock()
+		if conn.expired(lifetime) {
+			db.mu.Lock()
+			db.maxLifetimeClosed++
+			db.mu.Unlock()
+			conn.Close()
+			return nil, driver.ErrBadConn
+		}
+		if !conn.validate() {
+			db.mu.Lock()
+			db.maxBadConnClosed++
+			db.mu.Unlock()
+			conn.Close()
+			return nil, driver.ErrBadConn
+		}
 		return conn, nil
 	}
-	db.mu.Unlock()
 
+	//out of free connections.If we're not allowed to open any more,
+	//queue a connRequest and wait for the pool to free one up or open
+	//a new one.
+	if db.maxOpen > 0 && db.numOpen >= db.maxOpen {
+		req := make(chan connRequest, 1)
+		reqKey := db.nextRequestKeyLocked()
+		db.connRequests[reqKey] = req
+		db.waitCount++
+		db.mu.Unlock()
+
+		waitStart := nowFunc()
+
+		select {
+		case <-ctx.Done():
+			db.mu.Lock()
+			delete(db.connRequests, reqKey)
+			db.mu.Unlock()
+
+			atomic.AddInt64(&db.waitDuration, int64(nowFunc().Sub(waitStart)))
+
+			// The request may have been satisfied concurrently with
+			// ctx being done;if so,return that conn to the pool
+			// instead of leaking it.
+			select {
+			case ret, ok := <-req:
+				if ok && ret.conn != nil {
+					db.putConn(ret.conn, ret.err)
+				}
+			default:
+			}
+			return nil, ctx.Err()
+		case ret, ok := <-req:
+			atomic.AddInt64(&db.waitDuration, int64(nowFunc().Sub(waitStart)))
+
+			if !ok {
+				return nil, errDBClosed
+			}
+			if ret.err != nil {
+				return nil, ret.err
+			}
+			if ret.conn.expired(lifetime) {
+				db.mu.Lock()
+				db.maxLifetimeClosed++
+				db.mu.Unlock()
+				ret.conn.Close()
+				return nil, driver.ErrBadConn
+			}
+			if !ret.conn.validate() {
+				db.mu.Lock()
+				db.maxBadConnClosed++
+				db.mu.Unlock()
+				ret.conn.Close()
+				return nil, driver.ErrBadConn
+			}
+			return ret.conn, nil
+		}
+	}
+
+	db.numOpen++ //optimistically
+	db.mu.Unlock()
 	ci, err := db.driver.Open(db.dsn)
 	if err != nil {
+		db.mu.Lock()
+		db.numOpen--
+		db.maybeOpenNewConnections()
+		db.mu.Unlock()
 		return nil, err
 	}
+	db.mu.Lock()
 	dc := &driverConn{
-		db: db,
-		ci: ci,
+		db:         db,
+		createdAt:  nowFunc(),
+		returnedAt: nowFunc(),
+		ci:         ci,
 	}
-	db.mu.Lock()
 	db.addDepLocked(dc, dc)
 	dc.inUse = true
 	db.mu.Unlock()
 	return dc, nil
+}
+
+// withBadConnRetry runs attempt,which is responsible for acquiring its
+// own connection via db.conn and -- exactly as it would outside any
+// retry -- either returning that conn to the pool or leaving it pinned
+// to whatever it produced (as PrepareContext and QueryContext do on
+// success).conn()'s own retries only catch a dead idle conn via its
+// optional Pinger probe;a reused conn that the driver had no way to
+// pre-validate can still fail on its first real use,surfacing
+// driver.ErrBadConn from attempt itself.withBadConnRetry catches that
+// by discarding the bad conn (attempt already reported it via putConn)
+// and redoing the whole operation against a fresh one,up to
+// maxBadConnRetries times,so that failure doesn't reach the caller.
+func (db *DB) withBadConnRetry(attempt func() error) error {
+	var err error
+	for i := 0; i < maxBadConnRetries; i++ {
+		err = attempt()
+		if err != driver.ErrBadConn {
+			return err
+		}
+	}
+	return attempt()
+}
+
+// nextRequestKeyLocked returns the next key to use in db.connRequests.
+// Must be called while holding db.mu.
+func (db *DB) nextRequestKeyLocked() uint64 {
+	next := db.nextRequest
+	db.nextRequest++
+	return next
+}
+
+// CreateNode creates a node on a pooled connection.
+func (db *DB) CreateNode() (driver.Node, error) {
+	return db.CreateNodeContext(context.Background())
+}
+
+// CreateNodeContext creates a node on a pooled connection,honoring
+// ctx's deadline/cancellation both while acquiring the connection and
+// while the driver call is outstanding.A driver.ErrBadConn surfaced by
+// the call itself -- e.g.a reused conn that went stale between idle
+// health checks -- is retried against a fresh connection rather than
+// returned to the caller;see withBadConnRetry.
+func (db *DB) CreateNodeContext(ctx context.Context) (driver.Node, error) {
+	var n driver.Node
+	err := db.withBadConnRetry(func() error {
+		dc, err := db.conn(ctx)
+		if err != nil {
+			return err
+		}
+		n, err = db.createNodeDC(ctx, dc)
+		db.putConn(dc, err)
+		return err
+	})
+	return n, err
+}
+
+// createNodeDC prefers dc.ci's driver.NodeContext fast path;when the
+// driver doesn't implement it,the call still runs to completion but
+// the caller's wait is abandoned,and dc marked bad,once ctx is done.
+func (db *DB) createNodeDC(ctx context.Context, dc *driverConn) (driver.Node, error) {
+	if nc, ok := dc.ci.(driver.NodeContext); ok {
+		return nc.CreateNodeContext(ctx)
+	}
+	if ctx.Done() == nil {
+		return dc.ci.CreateNode()
+	}
+
+	type result struct {
+		n   driver.Node
+		err error
+	}
+	resCh := make(chan result, 1)
+	dep := new(abandonedCall)
+	db.addDep(dc, dep)
+	go func() {
+		n, err := dc.ci.CreateNode()
+		db.removeDep(dc, dep)
+		resCh <- result{n, err}
+	}()
+	select {
+	case <-ctx.Done():
+		dc.markBad()
+		return nil, ctx.Err()
+	case res := <-resCh:
+		return res.n, res.err
+	}
+}
+
+// Node fetches a node on a pooled connection.
+func (db *DB) Node() (driver.Node, error) {
+	return db.NodeContext(context.Background())
+}
+
+// NodeContext fetches a node on a pooled connection,honoring ctx the
+// same way CreateNodeContext does.
+func (db *DB) NodeContext(ctx context.Context) (driver.Node, error) {
+	var n driver.Node
+	err := db.withBadConnRetry(func() error {
+		dc, err := db.conn(ctx)
+		if err != nil {
+			return err
+		}
+		n, err = db.nodeDC(ctx, dc)
+		db.putConn(dc, err)
+		return err
+	})
+	return n, err
+}
+
+func (db *DB) nodeDC(ctx context.Context, dc *driverConn) (driver.Node, error) {
+	if ctx.Done() == nil {
+		return dc.ci.Node()
+	}
+
+	type result struct {
+		n   driver.Node
+		err error
+	}
+	resCh := make(chan result, 1)
+	dep := new(abandonedCall)
+	db.addDep(dc, dep)
+	go func() {
+		n, err := dc.ci.Node()
+		db.removeDep(dc, dep)
+		resCh <- result{n, err}
+	}()
+	select {
+	case <-ctx.Done():
+		dc.markBad()
+		return nil, ctx.Err()
+	case res := <-resCh:
+		return res.n, res.err
+	}
+}
+
+// CreateRelationship creates a relationship on a pooled connection.
+func (db *DB) CreateRelationship() (driver.Relationship, error) {
+	return db.CreateRelationshipContext(context.Background())
+}
+
+// CreateRelationshipContext creates a relationship on a pooled
+// connection,honoring ctx the same way CreateNodeContext does.
+func (db *DB) CreateRelationshipContext(ctx context.Context) (driver.Relationship, error) {
+	var r driver.Relationship
+	err := db.withBadConnRetry(func() error {
+		dc, err := db.conn(ctx)
+		if err != nil {
+			return err
+		}
+		r, err = db.createRelationshipDC(ctx, dc)
+		db.putConn(dc, err)
+		return err
+	})
+	return r, err
+}
+
+// createRelationshipDC prefers dc.ci's driver.RelationshipContext fast
+// path,falling back like createNodeDC otherwise.
+func (db *DB) createRelationshipDC(ctx context.Context, dc *driverConn) (driver.Relationship, error) {
+	if rc, ok := dc.ci.(driver.RelationshipContext); ok {
+		return rc.CreateRelationshipContext(ctx)
+	}
+	if ctx.Done() == nil {
+		return dc.ci.CreateRelationship()
+	}
+
+	type result struct {
+		r   driver.Relationship
+		err error
+	}
+	resCh := make(chan result, 1)
+	dep := new(abandonedCall)
+	db.addDep(dc, dep)
+	go func() {
+		r, err := dc.ci.CreateRelationship()
+		db.removeDep(dc, dep)
+		resCh <- result{r, err}
+	}()
+	select {
+	case <-ctx.Done():
+		dc.markBad()
+		return nil, ctx.Err()
+	case res := <-resCh:
+		return res.r, res.err
+	}
+}
+
+// NodeProperties fetches n's properties,honoring ctx.If n implements
+// driver.NodePropertiesContext that fast path is used directly;
+// otherwise Properties runs to completion regardless,but ctx.Done()
+// still lets the caller stop waiting on it.
+func NodeProperties(ctx context.Context, n driver.Node) (map[string]interface{}, error) {
+	if pc, ok := n.(driver.NodePropertiesContext); ok {
+		return pc.PropertiesContext(ctx)
+	}
+	if ctx.Done() == nil {
+		return n.Properties()
+	}
+
+	type result struct {
+		props map[string]interface{}
+		err   error
+	}
+	resCh := make(chan result, 1)
+	go func() {
+		props, err := n.Properties()
+		resCh <- result{props, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-resCh:
+		return res.props, res.err
+	}
+}
+
+// TxOptions holds the optional settings that control how a
+// transaction is started.The zero value starts a default,read-write
+// transaction.
+type TxOptions struct {
+	// ReadOnly marks the transaction as read-only,which drivers
+	// backed by a replica set may use to route its traversals off
+	// the primary.
+	ReadOnly bool
+}
+
+var errTxDone = errors.New("graph: transaction has already been committed or rolled back")
+
+// Tx is an in-progress graph transaction.A Tx pins a single
+// driverConn for its lifetime -- the connection is not returned to
+// the pool until Commit or Rollback is called -- and exposes the same
+// node/relationship creation surface as DB.
+type Tx struct {
+	db *DB
+	dc *driverConn
+
+	mu   sync.Mutex
+	txi  driver.Tx
+	done bool
+}
+
+// Begin starts a transaction on a pooled connection.
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginTx(context.Background(), TxOptions{})
+}
+
+// BeginTx starts a transaction on a pooled connection,honoring ctx's
+// deadline/cancellation and opts.
+//
+// The driver backing db must implement driver.ConnBeginTx;otherwise
+// BeginTx returns an error.
+func (db *DB) BeginTx(ctx context.Context, opts TxOptions) (*Tx, error) {
+	dc, err := db.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return db.beginDC(ctx, dc, opts)
+}
+
+func (db *DB) beginDC(ctx context.Context, dc *driverConn, opts TxOptions) (*Tx, error) {
+	btx, ok := dc.ci.(driver.ConnBeginTx)
+	if !ok {
+		db.putConn(dc, nil)
+		return nil, errors.New("graph: driver does not support transactions")
+	}
+	txi, err := btx.BeginTx(ctx, driver.TxOptions{ReadOnly: opts.ReadOnly})
+	if err != nil {
+		db.putConn(dc, err)
+		return nil, err
+	}
+	return &Tx{db: db, dc: dc, txi: txi}, nil
+}
+
+// grabConn returns tx's pinned connection,or errTxDone if the
+// transaction has already completed.
+func (tx *Tx) grabConn() (*driverConn, error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, errTxDone
+	}
+	return tx.dc, nil
+}
+
+// close marks tx as done and returns its pinned connection to the
+// pool,reporting err to the pool so a bad connection isn't reused.
+func (tx *Tx) close(err error) error {
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return errTxDone
+	}
+	tx.done = true
+	tx.mu.Unlock()
+
+	tx.db.putConn(tx.dc, err)
+	return err
+}
+
+// Commit commits the transaction.
+func (tx *Tx) Commit() error {
+	return tx.close(tx.txi.Commit())
+}
+
+// Rollback aborts the transaction.
+func (tx *Tx) Rollback() error {
+	return tx.close(tx.txi.Rollback())
+}
+
+// CreateNode creates a node within the transaction.
+func (tx *Tx) CreateNode() (driver.Node, error) {
+	return tx.CreateNodeContext(context.Background())
+}
+
+// CreateNodeContext creates a node within the transaction,honoring
+// ctx the same way DB.CreateNodeContext does.
+func (tx *Tx) CreateNodeContext(ctx context.Context) (driver.Node, error) {
+	dc, err := tx.grabConn()
+	if err != nil {
+		return nil, err
+	}
+	return tx.db.createNodeDC(ctx, dc)
+}
+
+// Node fetches a node within the transaction.
+func (tx *Tx) Node() (driver.Node, error) {
+	return tx.NodeContext(context.Background())
+}
+
+// NodeContext fetches a node within the transaction,honoring ctx the
+// same way DB.NodeContext does.
+func (tx *Tx) NodeContext(ctx context.Context) (driver.Node, error) {
+	dc, err := tx.grabConn()
+	if err != nil {
+		return nil, err
+	}
+	return tx.db.nodeDC(ctx, dc)
+}
+
+// CreateRelationship creates a relationship within the transaction.
+func (tx *Tx) CreateRelationship() (driver.Relationship, error) {
+	return tx.CreateRelationshipContext(context.Background())
+}
+
+// CreateRelationshipContext creates a relationship within the
+// transaction,honoring ctx the same way DB.CreateRelationshipContext
+// does.
+func (tx *Tx) CreateRelationshipContext(ctx context.Context) (driver.Relationship, error) {
+	dc, err := tx.grabConn()
+	if err != nil {
+		return nil, err
+	}
+	return tx.db.createRelationshipDC(ctx, dc)
+}
+
+// Prepare creates a prepared statement for later queries or
+// executions on a pooled connection.
+func (db *DB) Prepare(query string) (*Stmt, error) {
+	return db.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext creates a prepared statement on a pooled connection,
+// honoring ctx while acquiring it.A driver.ErrBadConn from Prepare
+// itself is retried against a fresh connection;see withBadConnRetry.
+func (db *DB) PrepareContext(ctx context.Context, query string) (*Stmt, error) {
+	var stmt *Stmt
+	err := db.withBadConnRetry(func() error {
+		dc, err := db.conn(ctx)
+		if err != nil {
+			return err
+		}
+		si, err := dc.ci.Prepare(query)
+		if err != nil {
+			db.putConn(dc, err)
+			return err
+		}
+		stmt = db.newStmt(dc, query, si)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// Query executes a query that returns rows.
+func (db *DB) Query(query string, args []driver.Value) (*Rows, error) {
+	return db.QueryContext(context.Background(), query, args)
+}
+
+// QueryContext executes a query that returns rows,honoring ctx while
+// acquiring a connection.
+//
+// If the connection's driver implements driver.Queryer,that fast path
+// is used directly;otherwise QueryContext falls back to preparing
+// query,running it,and closing the prepared statement once the
+// returned Rows is closed.A driver.ErrBadConn from the query itself is
+// retried against a fresh connection;see withBadConnRetry.
+func (db *DB) QueryContext(ctx context.Context, query string, args []driver.Value) (*Rows, error) {
+	var rows *Rows
+	err := db.withBadConnRetry(func() error {
+		dc, err := db.conn(ctx)
+		if err != nil {
+			return err
+		}
+		rows, err = db.queryDC(dc, query, args)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
 
+func (db *DB) queryDC(dc *driverConn, query string, args []driver.Value) (*Rows, error) {
+	if queryer, ok := dc.ci.(driver.Queryer); ok {
+		rowsi, err := queryer.Query(query, args)
+		if err != driver.ErrSkip {
+			if err != nil {
+				db.putConn(dc, err)
+				return nil, err
+			}
+			return db.newRowsWithDriver(dc, rowsi, true), nil
+		}
+	}
+
+	si, err := dc.ci.Prepare(query)
+	if err != nil {
+		db.putConn(dc, err)
+		return nil, err
+	}
+	rowsi, err := si.Query(args)
+	if err != nil {
+		si.Close()
+		db.putConn(dc, err)
+		return nil, err
+	}
+	rows := db.newRowsWithDriver(dc, rowsi, true)
+	rows.closeStmt = si
+	return rows, nil
+}
+
+// Exec executes a query that doesn't return rows,such as a mutating
+// Cypher/Gremlin statement.
+func (db *DB) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return db.ExecContext(context.Background(), query, args)
+}
+
+// ExecContext executes a query that doesn't return rows,honoring ctx
+// while acquiring a connection.
+//
+// If the connection's driver implements driver.Execer,that fast path
+// is used directly;otherwise ExecContext falls back to preparing the
+// query,executing it,and closing the prepared statement.A
+// driver.ErrBadConn from the exec itself is retried against a fresh
+// connection;see withBadConnRetry.
+func (db *DB) ExecContext(ctx context.Context, query string, args []driver.Value) (driver.Result, error) {
+	var res driver.Result
+	err := db.withBadConnRetry(func() error {
+		dc, err := db.conn(ctx)
+		if err != nil {
+			return err
+		}
+		res, err = db.execDC(dc, query, args)
+		db.putConn(dc, err)
+		return err
+	})
+	return res, err
+}
+
+func (db *DB) execDC(dc *driverConn, query string, args []driver.Value) (driver.Result, error) {
+	if execer, ok := dc.ci.(driver.Execer); ok {
+		res, err := execer.Exec(query, args)
+		if err != driver.ErrSkip {
+			return res, err
+		}
+	}
+
+	si, err := dc.ci.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer si.Close()
+	return si.Exec(args)
+}
+
+// expired reports whether dc should be discarded given the connection
+// lifetime limit d.
+func (dc *driverConn) expired(d time.Duration) bool {
+	if d <= 0 {
+		return false
+	}
+	return dc.createdAt.Add(d).Before(nowFunc())
+}
+
+// validate opportunistically checks that dc is still alive via
+// driver.Pinger before conn() hands it back out of the idle pool.A
+// driver that doesn't implement Pinger is assumed healthy;conn()
+// instead relies on the next operation against dc to report
+// driver.ErrBadConn.
+func (dc *driverConn) validate() bool {
+	pinger, ok := dc.ci.(driver.Pinger)
+	if !ok {
+		return true
+	}
+	return pinger.Ping() == nil
 }
 
 type finalCloser interface {
@@ -136,6 +972,12 @@ func (dc *driverConn) finalClose() error {
 	dc.finalClosed = true
 
 	dc.Unlock()
+
+	dc.db.mu.Lock()
+	dc.db.numOpen--
+	dc.db.maybeOpenNewConnections()
+	dc.db.mu.Unlock()
+
 	return err
 
 }
@@ -158,6 +1000,19 @@ func (dc *driverConn) Close() error {
 	return fn()
 }
 
+// closeDBLocked closes dc as part of DB.Close,returning a func that
+// performs the final close once db.mu has been released.db.mu must be
+// held when calling this.
+func (dc *driverConn) closeDBLocked() func() error {
+	dc.Lock()
+	defer dc.Unlock()
+	if dc.closed {
+		return func() error { return nil }
+	}
+	dc.closed = true
+	return dc.db.removeDepLocked(dc, dc)
+}
+
 // driverStmt associates a driver.Stmt with the
 // *driverConn from which it came,so the driverConn's lock can be
 // held during calls.
@@ -172,9 +1027,239 @@ func (ds *driverStmt) Close() error {
 	return ds.si.Close()
 }
 
+// errStmtClosed is returned by a Stmt's Exec/Query once it has been
+// closed.
+var errStmtClosed = errors.New("graph: statement is closed")
+
+// Stmt is a prepared statement bound to a single connection.Preparing
+// a Stmt checks its driverConn out of the pool for the Stmt's whole
+// lifetime;the conn is only returned to the pool once Close runs.
+type Stmt struct {
+	db    *DB
+	query string
+
+	mu      sync.Mutex
+	dc      *driverConn
+	si      driver.Stmt
+	closed  bool
+	numRows int //outstanding Rows obtained via Query,not yet closed
+}
+
+// newStmt wraps si,adds it to dc's set of open statements,and marks
+// dc as depended-on so it isn't finalized while the Stmt is open.
+func (db *DB) newStmt(dc *driverConn, query string, si driver.Stmt) *Stmt {
+	dc.Lock()
+	if dc.openStmt == nil {
+		dc.openStmt = make(map[driver.Stmt]bool)
+	}
+	dc.openStmt[si] = true
+	dc.Unlock()
+
+	stmt := &Stmt{db: db, query: query, dc: dc, si: si}
+	db.addDep(dc, stmt)
+	return stmt
+}
+
+// Exec executes a query that doesn't return rows,such as a mutating
+// Cypher/Gremlin statement,against the Stmt's connection.
+func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errStmtClosed
+	}
+	si := s.si
+	s.mu.Unlock()
+	return si.Exec(args)
+}
+
+// Query executes the Stmt and returns the resulting Rows.The Stmt's
+// connection is held open for as long as either the Stmt or the
+// returned Rows is -- closing the Stmt while the Rows is still open
+// does not return the connection to the pool,since the Rows may still
+// be reading from it.
+func (s *Stmt) Query(args []driver.Value) (*Rows, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errStmtClosed
+	}
+	dc, si := s.dc, s.si
+	s.numRows++
+	s.mu.Unlock()
+
+	rowsi, err := si.Query(args)
+	if err != nil {
+		s.mu.Lock()
+		s.numRows--
+		s.mu.Unlock()
+		return nil, err
+	}
+	rows := s.db.newRowsWithDriver(dc, rowsi, false)
+	rows.stmt = s
+	return rows, nil
+}
+
+// rowsClosed records that one of s's outstanding Rows has closed,
+// reporting whether s is now fully released -- Close has already been
+// called and no Rows obtained from it remain open -- so the caller
+// (Rows.Close) knows whether it,rather than a prior or future
+// Stmt.Close,is responsible for returning s's connection to the pool.
+func (s *Stmt) rowsClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.numRows--
+	return s.closed && s.numRows == 0
+}
+
+// Close closes the statement.
+//
+// Closing a Stmt releases its own hold on the underlying connection,
+// but the connection itself is only finalized once every other
+// dependent (such as an in-flight Rows reading from the same conn)
+// has also released it,and it is only returned to the pool once the
+// last of the Stmt and any Rows obtained from it has released it --
+// otherwise a Rows still reading from the conn could be handed out to
+// another caller while still in use.
+func (s *Stmt) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	dc, si, numRows := s.dc, s.si, s.numRows
+	s.mu.Unlock()
+
+	dc.Lock()
+	delete(dc.openStmt, si)
+	dc.Unlock()
+
+	err := si.Close()
+	if derr := s.db.removeDep(dc, s); err == nil {
+		err = derr
+	}
+	if numRows == 0 {
+		s.db.putConn(dc, err)
+	}
+	return err
+}
+
+// Rows is the result of a query.While a Rows is open,the driverConn
+// it reads from is held open even if the Stmt or Conn it came from has
+// been closed,and,for Rows obtained directly from DB.Query,checked
+// out of the pool until the Rows is closed.
+type Rows struct {
+	mu          sync.Mutex
+	dc          *driverConn
+	rowsi       driver.Rows
+	closeStmt   driver.Stmt //non-nil for the Prepare->Query->Close fallback
+	releaseConn bool        //true when Close should also return dc to the pool
+	stmt        *Stmt       //non-nil when obtained via Stmt.Query;Close defers to stmt.rowsClosed
+	closed      bool
+}
+
+// newRows marks dc as depended-on by the returned Rows,so dc isn't
+// finalized until the Rows is closed or drained.
+func (db *DB) newRows(dc *driverConn) *Rows {
+	rows := &Rows{dc: dc}
+	db.addDep(dc, rows)
+	return rows
+}
+
+// newRowsWithDriver is newRows plus the driver.Rows backing it.
+// releaseConn should be true only when the caller checked dc out of
+// the pool solely on the Rows' behalf (as DB.Query does);a Rows
+// obtained through a Stmt must leave the pool release to the Stmt.
+func (db *DB) newRowsWithDriver(dc *driverConn, rowsi driver.Rows, releaseConn bool) *Rows {
+	rows := db.newRows(dc)
+	rows.rowsi = rowsi
+	rows.releaseConn = releaseConn
+	return rows
+}
+
+// Columns returns the names of the result columns.
+func (rs *Rows) Columns() []string {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.closed || rs.rowsi == nil {
+		return nil
+	}
+	return rs.rowsi.Columns()
+}
+
+// Next populates dest with the next row of data.It returns io.EOF
+// once the Rows is exhausted or has been closed;reaching io.EOF closes
+// the Rows,as Close would.
+func (rs *Rows) Next(dest []driver.Value) error {
+	rs.mu.Lock()
+	if rs.closed || rs.rowsi == nil {
+		rs.mu.Unlock()
+		return io.EOF
+	}
+	err := rs.rowsi.Next(dest)
+	rs.mu.Unlock()
+	if err == io.EOF {
+		rs.Close()
+	}
+	return err
+}
+
+// Close closes the Rows,releasing its hold on the underlying
+// connection and,if it was produced via the Prepare->Query->Close
+// fallback,the Stmt prepared to run it.It is safe to call Close more
+// than once.
+func (rs *Rows) Close() error {
+	rs.mu.Lock()
+	if rs.closed {
+		rs.mu.Unlock()
+		return nil
+	}
+	rs.closed = true
+	dc, rowsi, closeStmt, releaseConn, stmt := rs.dc, rs.rowsi, rs.closeStmt, rs.releaseConn, rs.stmt
+	rs.mu.Unlock()
+
+	var err error
+	if rowsi != nil {
+		err = rowsi.Close()
+	}
+	if closeStmt != nil {
+		if serr := closeStmt.Close(); err == nil {
+			err = serr
+		}
+	}
+	if derr := dc.db.removeDep(dc, rs); err == nil {
+		err = derr
+	}
+
+	if releaseConn {
+		dc.db.putConn(dc, err)
+	} else if stmt != nil && stmt.rowsClosed() {
+		dc.db.putConn(dc, err)
+	}
+	return err
+}
+
 // depSet is a finalCloser's outstanding dependencies
 type depSet map[interface{}]bool //set of true bools
 
+// addDep locks db.mu and registers dep as an outstanding dependent of
+// x,deferring x.finalClose until dep is released via removeDep.
+func (db *DB) addDep(x finalCloser, dep interface{}) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.addDepLocked(x, dep)
+}
+
+// removeDep locks db.mu,releases dep from x's dependents,and runs
+// x.finalClose if dep was the last outstanding dependent.
+func (db *DB) removeDep(x finalCloser, dep interface{}) error {
+	db.mu.Lock()
+	fn := db.removeDepLocked(x, dep)
+	db.mu.Unlock()
+	return fn()
+}
+
 func (db *DB) addDepLocked(x finalCloser, dep interface{}) {
 	if db.dep == nil {
 		db.dep = make(map[finalCloser]depSet)
@@ -194,8 +1279,14 @@ const debugGetPut = false
 // putConn adds a connection to the db's pool.
 // err is optionally the last error that occurred on this connection.
 func (db *DB) putConn(dc *driverConn, err error) {
+	dc.Lock()
+	if dc.bad {
+		err = driver.ErrBadConn
+	}
+	dc.Unlock()
+
 	db.mu.Lock()
-	if dc.inUse {
+	if !dc.inUse {
 		if debugGetPut {
 			fmt.Printf("putConn(%v) DUPLICATE was: %s\n\nPREVIOUS was: %s", dc, stack(), db.lastPut[dc])
 		}
@@ -205,6 +1296,7 @@ func (db *DB) putConn(dc *driverConn, err error) {
 		db.lastPut[dc] = stack()
 	}
 	dc.inUse = false
+	dc.returnedAt = nowFunc()
 	for _, fn := range dc.onPut {
 		fn()
 	}
@@ -212,7 +1304,10 @@ func (db *DB) putConn(dc *driverConn, err error) {
 
 	if err == driver.ErrBadConn {
 		// Don't reuse bad connections.
+		// numOpen is decremented by finalClose once dc.Close runs below.
+		db.maybeOpenNewConnections()
 		db.mu.Unlock()
+		dc.Close()
 		return
 	}
 
@@ -220,14 +1315,50 @@ func (db *DB) putConn(dc *driverConn, err error) {
 		putConnHook(db, dc)
 	}
 
-	if n := len(db.freeConn); !db.closed && n < db.maxIdleConnsLocked() {
-		db.freeConn = append(db.freeConn, dc)
-		db.mu.Unlock()
-		return
-	}
+	added := db.putConnDBLocked(dc, nil)
 	db.mu.Unlock()
-	dc.Close()
 
+	if !added {
+		dc.Close()
+	}
+}
+
+// putConnDBLocked either satisfies a waiting connRequest with dc,or
+// returns dc to the idle pool.err,when non-nil,is delivered to a
+// waiting connRequest instead of dc (dc is ignored in that case).
+// Reports whether dc (or err) was handed off;if false,the caller is
+// responsible for closing dc.db.mu must be held.
+func (db *DB) putConnDBLocked(dc *driverConn, err error) bool {
+	if db.closed {
+		return false
+	}
+	if db.maxOpen > 0 && db.numOpen > db.maxOpen {
+		return false
+	}
+	if c := len(db.connRequests); c > 0 {
+		var req chan connRequest
+		var reqKey uint64
+		for reqKey, req = range db.connRequests {
+			break
+		}
+		delete(db.connRequests, reqKey)
+		if err == nil {
+			dc.inUse = true
+		}
+		req <- connRequest{
+			conn: dc,
+			err:  err,
+		}
+		return true
+	} else if err == nil && !db.closed {
+		if db.maxIdleConnsLocked() > len(db.freeConn) {
+			db.freeConn = append(db.freeConn, dc)
+			db.startCleanerLocked()
+			return true
+		}
+		db.maxIdleClosed++
+	}
+	return false
 }
 
 func (db *DB) removeDepLocked(x finalCloser, dep interface{}) func() error {
@@ -266,6 +1397,308 @@ func (db *DB) maxIdleConnsLocked() int {
 	}
 }
 
+// SetMaxIdleConns sets the maximum number of connections in the idle
+// connection pool.
+//
+// If MaxOpenConns is greater than 0 but less than the new MaxIdleConns,
+// then the new MaxIdleConns will be reduced to match the MaxOpenConns
+// limit.
+//
+// If n <= 0,no idle connections are retained.
+func (db *DB) SetMaxIdleConns(n int) {
+	db.mu.Lock()
+	if n > 0 {
+		db.maxIdle = n
+	} else {
+		db.maxIdle = -1
+	}
+	//make sure maxIdle doesn't exceed maxOpen
+	if db.maxOpen > 0 && db.maxIdleConnsLocked() > db.maxOpen {
+		db.maxIdle = db.maxOpen
+	}
+	var closing []*driverConn
+	idleCount := len(db.freeConn)
+	maxIdle := db.maxIdleConnsLocked()
+	if idleCount > maxIdle {
+		closing = db.freeConn[maxIdle:]
+		db.freeConn = db.freeConn[:maxIdle]
+	}
+	db.maxIdleClosed += int64(len(closing))
+	db.mu.Unlock()
+	for _, c := range closing {
+		c.Close()
+	}
+}
+
+// SetMaxOpenConns sets the maximum number of open connections to the
+// database.
+//
+// If MaxIdleConns is greater than 0 and the new MaxOpenConns is less
+// than MaxIdleConns,then MaxIdleConns will be reduced to match the new
+// MaxOpenConns limit.
+//
+// If n <= 0,then there is no limit on the number of open connections.
+// The default is 0 (unlimited).
+func (db *DB) SetMaxOpenConns(n int) {
+	db.mu.Lock()
+	db.maxOpen = n
+	if n < 0 {
+		db.maxOpen = 0
+	}
+	syncMaxIdle := db.maxOpen > 0 && db.maxIdleConnsLocked() > db.maxOpen
+	db.mu.Unlock()
+	if syncMaxIdle {
+		db.SetMaxIdleConns(n)
+	}
+}
+
+// SetConnMaxLifetime sets the maximum amount of time a connection may
+// be reused.
+//
+// Expired connections may be closed lazily before reuse.
+//
+// If d <= 0,connections are not closed due to a connection's age.
+func (db *DB) SetConnMaxLifetime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	db.mu.Lock()
+	//wake cleaner up when lifetime is shortened.
+	if d > 0 && d < db.maxLifetime && db.cleanerCh != nil {
+		select {
+		case db.cleanerCh <- struct{}{}:
+		default:
+		}
+	}
+	db.maxLifetime = d
+	db.startCleanerLocked()
+	db.mu.Unlock()
+}
+
+// SetConnMaxIdleTime sets the maximum amount of time a connection may
+// be idle before being closed.
+//
+// Expired connections may be closed lazily before reuse.
+//
+// If d <= 0,connections are not closed due to a connection's idle time.
+func (db *DB) SetConnMaxIdleTime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	//wake cleaner up when idle time is shortened.
+	if d > 0 && d < db.maxIdleTime && db.cleanerCh != nil {
+		select {
+		case db.cleanerCh <- struct{}{}:
+		default:
+		}
+	}
+	db.maxIdleTime = d
+	db.startCleanerLocked()
+}
+
+// startCleanerLocked starts connectionCleaner if needed.db.mu must be
+// held.
+func (db *DB) startCleanerLocked() {
+	if (db.maxLifetime > 0 || db.maxIdleTime > 0) && db.numOpen > 0 && db.cleanerCh == nil {
+		db.cleanerCh = make(chan struct{}, 1)
+		go db.connectionCleaner(db.shortestIdleTimeLocked())
+	}
+}
+
+// connectionCleaner runs in a goroutine and periodically wakes up to
+// close connections that exceed MaxIdleTime or MaxLifetime.
+func (db *DB) connectionCleaner(d time.Duration) {
+	const minInterval = time.Second
+
+	if d < minInterval {
+		d = minInterval
+	}
+	t := time.NewTimer(d)
+
+	for {
+		select {
+		case <-t.C:
+		case <-db.cleanerCh: //maxLifetime or maxIdleTime was changed,or db was closed.
+		}
+
+		db.mu.Lock()
+		d = db.shortestIdleTimeLocked()
+		if db.closed || db.numOpen == 0 || d <= 0 {
+			db.cleanerCh = nil
+			db.mu.Unlock()
+			return
+		}
+
+		d, closing := db.connectionCleanerRunLocked(d)
+		db.mu.Unlock()
+		for _, c := range closing {
+			c.Close()
+		}
+		db.pingIdleConns()
+
+		if d < minInterval {
+			d = minInterval
+		}
+
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		t.Reset(d)
+	}
+}
+
+// connectionCleanerRunLocked closes connections past MaxIdleTime or
+// MaxLifetime and returns the duration until the next connection
+// expires along with the connections to close.db.mu must be held.
+func (db *DB) connectionCleanerRunLocked(d time.Duration) (time.Duration, []*driverConn) {
+	var idleClosing []*driverConn
+	if db.maxIdleTime > 0 {
+		//freeConn is not sorted by returnedAt,so a full scan is required.
+		idleSince := nowFunc().Add(-db.maxIdleTime)
+		for i := 0; i < len(db.freeConn); i++ {
+			c := db.freeConn[i]
+			if c.returnedAt.Before(idleSince) {
+				idleClosing = append(idleClosing, c)
+				db.maxIdleClosed++
+				last := len(db.freeConn) - 1
+				db.freeConn[i] = db.freeConn[last]
+				db.freeConn[last] = nil
+				db.freeConn = db.freeConn[:last]
+				i--
+			} else {
+				d2 := c.returnedAt.Sub(idleSince)
+				if d2 < d {
+					d = d2
+				}
+			}
+		}
+	}
+
+	if db.maxLifetime > 0 {
+		expiredSince := nowFunc().Add(-db.maxLifetime)
+		for i := 0; i < len(db.freeConn); i++ {
+			c := db.freeConn[i]
+			if c.createdAt.Before(expiredSince) {
+				db.maxLifetimeClosed++
+				idleClosing = append(idleClosing, c)
+				last := len(db.freeConn) - 1
+				db.freeConn[i] = db.freeConn[last]
+				db.freeConn[last] = nil
+				db.freeConn = db.freeConn[:last]
+				i--
+			} else {
+				d2 := c.createdAt.Sub(expiredSince)
+				if d2 < d {
+					d = d2
+				}
+			}
+		}
+	}
+
+	return d, idleClosing
+}
+
+// pingIdleConns opportunistically probes every currently-idle
+// connection that implements driver.Pinger and discards any that fail
+// the probe,so a dropped connection is caught by the cleaner instead
+// of surfacing as driver.ErrBadConn on a caller's next operation.
+// Connections that don't implement driver.Pinger are left alone.
+func (db *DB) pingIdleConns() {
+	db.mu.Lock()
+	candidates := append([]*driverConn(nil), db.freeConn...)
+	db.mu.Unlock()
+
+	for _, c := range candidates {
+		pinger, ok := c.ci.(driver.Pinger)
+		if !ok {
+			continue
+		}
+		if pinger.Ping() == nil {
+			continue
+		}
+
+		db.mu.Lock()
+		found := false
+		for i, fc := range db.freeConn {
+			if fc == c {
+				last := len(db.freeConn) - 1
+				db.freeConn[i] = db.freeConn[last]
+				db.freeConn[last] = nil
+				db.freeConn = db.freeConn[:last]
+				db.maxBadConnClosed++
+				found = true
+				break
+			}
+		}
+		db.mu.Unlock()
+		if found {
+			c.Close()
+		}
+	}
+}
+
+// shortestIdleTimeLocked returns the minimum of maxIdleTime and
+// maxLifetime,ignoring whichever is <=0.db.mu must be held.
+func (db *DB) shortestIdleTimeLocked() time.Duration {
+	if db.maxIdleTime <= 0 {
+		return db.maxLifetime
+	}
+	if db.maxLifetime <= 0 {
+		return db.maxIdleTime
+	}
+	min := db.maxIdleTime
+	if min > db.maxLifetime {
+		min = db.maxLifetime
+	}
+	return min
+}
+
+// DBStats contains database statistics.
+type DBStats struct {
+	MaxOpenConnections int //maximum number of open connections to the database
+
+	//pool status
+	OpenConnections int //the number of established connections both in use and idle
+	InUse           int //the number of connections currently in use
+	Idle            int //the number of idle connections
+
+	//counters
+	WaitCount         int64         //the total number of connections waited for
+	WaitDuration      time.Duration //the total time blocked waiting for a new connection
+	MaxIdleClosed     int64         //the total number of connections closed due to SetMaxIdleConns or SetConnMaxIdleTime
+	MaxLifetimeClosed int64         //the total number of connections closed due to SetConnMaxLifetime
+	MaxBadConnClosed  int64         //the total number of connections closed for failing a driver.Pinger liveness check
+}
+
+// Stats returns database statistics.
+func (db *DB) Stats() DBStats {
+	wait := atomic.LoadInt64(&db.waitDuration)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stats := DBStats{
+		MaxOpenConnections: db.maxOpen,
+
+		Idle:            len(db.freeConn),
+		OpenConnections: db.numOpen,
+		InUse:           db.numOpen - len(db.freeConn),
+
+		WaitCount:         db.waitCount,
+		WaitDuration:      time.Duration(wait),
+		MaxIdleClosed:     db.maxIdleClosed,
+		MaxLifetimeClosed: db.maxLifetimeClosed,
+		MaxBadConnClosed:  db.maxBadConnClosed,
+	}
+	return stats
+}
+
 // putConnHook is a hook for testing
 var putConnHook func(*DB, *driverConn)
 
@@ -0,0 +1,180 @@
+package graph
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloudcube/database/graph/driver"
+)
+
+// pingableConn is a fakeConn that also implements driver.Pinger,
+// failing the first n pings before reporting healthy.
+type pingableConn struct {
+	fakeConn
+	failPings int
+	pings     int
+}
+
+func (c *pingableConn) Ping() error {
+	c.pings++
+	if c.pings <= c.failPings {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+// TestConnDiscardsDeadIdleConnOnReuse verifies that conn() health-checks
+// a connection popped off the idle pool via driver.Pinger and,when the
+// probe fails,transparently discards it and hands out a freshly opened
+// connection instead of returning the dead one to the caller.
+func TestConnDiscardsDeadIdleConnOnReuse(t *testing.T) {
+	fakeDriver := &poolFakeDriver{}
+	db := &DB{
+		driver:       fakeDriver,
+		dsn:          "test",
+		connRequests: make(map[uint64]chan connRequest),
+		lastPut:      make(map[*driverConn]string),
+	}
+
+	dead := &pingableConn{failPings: 1}
+	dc := &driverConn{db: db, ci: dead}
+	db.addDepLocked(dc, dc)
+	db.numOpen = 1
+	db.freeConn = append(db.freeConn, dc)
+
+	got, err := db.conn(context.Background())
+	if err != nil {
+		t.Fatalf("conn: %v", err)
+	}
+	if got.ci == dead {
+		t.Fatalf("expected the dead idle connection to be discarded,not reused")
+	}
+	if !dead.closed {
+		t.Fatalf("expected the dead idle connection to be closed")
+	}
+	if fakeDriver.opened != 1 {
+		t.Fatalf("expected a single fresh connection to be opened,got %d", fakeDriver.opened)
+	}
+}
+
+// poolFakeDriver opens fresh pingableConns that always report healthy.
+type poolFakeDriver struct {
+	opened int
+}
+
+func (d *poolFakeDriver) Open(name string) (driver.Conn, error) {
+	d.opened++
+	return &pingableConn{}, nil
+}
+
+// staleConn is a fakeConn that doesn't implement driver.Pinger (so
+// validate treats it as healthy) but fails its first real operation
+// with driver.ErrBadConn,simulating a connection that went stale
+// after the last idle health check.
+type staleConn struct {
+	fakeConn
+	uses int
+}
+
+func (c *staleConn) CreateNode() (driver.Node, error) {
+	c.uses++
+	return nil, driver.ErrBadConn
+}
+
+// freshConn is a fakeConn whose CreateNode always succeeds.
+type freshConn struct {
+	fakeConn
+}
+
+func (c *freshConn) CreateNode() (driver.Node, error) {
+	return nil, nil
+}
+
+// staleConnFakeDriver opens fresh,healthy freshConns.
+type staleConnFakeDriver struct {
+	opened int
+}
+
+func (d *staleConnFakeDriver) Open(name string) (driver.Conn, error) {
+	d.opened++
+	return &freshConn{}, nil
+}
+
+// TestCreateNodeContextRetriesOnBadConnFromFirstUse verifies that when
+// a reused idle connection's first real operation reports
+// driver.ErrBadConn -- a failure validate's Pinger probe can't catch,
+// since staleConn doesn't implement driver.Pinger -- CreateNodeContext
+// discards it and transparently retries the whole call against a
+// fresh connection instead of surfacing the error.
+func TestCreateNodeContextRetriesOnBadConnFromFirstUse(t *testing.T) {
+	fakeDriver := &staleConnFakeDriver{}
+	db := &DB{
+		driver:       fakeDriver,
+		dsn:          "test",
+		connRequests: make(map[uint64]chan connRequest),
+		lastPut:      make(map[*driverConn]string),
+	}
+
+	stale := &staleConn{}
+	dc := &driverConn{db: db, ci: stale}
+	db.addDepLocked(dc, dc)
+	db.numOpen = 1
+	db.freeConn = append(db.freeConn, dc)
+
+	if _, err := db.CreateNodeContext(context.Background()); err != nil {
+		t.Fatalf("CreateNodeContext: %v", err)
+	}
+	if stale.uses != 1 {
+		t.Fatalf("expected the stale reused conn to be tried exactly once,got %d", stale.uses)
+	}
+	if !stale.closed {
+		t.Fatalf("expected the stale reused conn to be discarded")
+	}
+	if fakeDriver.opened != 1 {
+		t.Fatalf("expected exactly one fresh connection to be opened on retry,got %d", fakeDriver.opened)
+	}
+}
+
+// trackingFakeDriver opens fakeConns and remembers the most recently
+// opened one so a test can inspect it after openNewConnection discards it.
+type trackingFakeDriver struct {
+	lastConn *fakeConn
+}
+
+func (d *trackingFakeDriver) Open(name string) (driver.Conn, error) {
+	c := &fakeConn{}
+	d.lastConn = c
+	return c, nil
+}
+
+// TestOpenNewConnectionDiscardsWithoutLeakingDep verifies that when
+// putConnDBLocked declines a freshly opened connection (e.g.the idle
+// pool has no room and no caller is waiting),openNewConnection tears
+// it down through the normal dep-removal -> finalClose path instead of
+// closing it directly and leaving its self-dep in db.dep forever.
+func TestOpenNewConnectionDiscardsWithoutLeakingDep(t *testing.T) {
+	fakeDriver := &trackingFakeDriver{}
+	db := &DB{
+		driver:       fakeDriver,
+		dsn:          "test",
+		connRequests: make(map[uint64]chan connRequest),
+		lastPut:      make(map[*driverConn]string),
+		maxIdle:      -1, //no idle conns retained,so putConnDBLocked discards dc
+	}
+	db.numOpen = 1 //as maybeOpenNewConnections would have incremented optimistically
+
+	db.openNewConnection()
+
+	if fakeDriver.lastConn == nil || !fakeDriver.lastConn.closed {
+		t.Fatalf("expected the discarded connection's underlying driver.Conn to be closed")
+	}
+	if len(db.dep) != 0 {
+		t.Fatalf("expected no leaked dep entries after discard,got %d", len(db.dep))
+	}
+	if len(db.freeConn) != 0 {
+		t.Fatalf("expected dc not to be added to the idle pool,got %d", len(db.freeConn))
+	}
+	if db.numOpen != 0 {
+		t.Fatalf("expected numOpen to be decremented back to 0,got %d", db.numOpen)
+	}
+}
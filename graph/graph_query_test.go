@@ -0,0 +1,133 @@
+package graph
+
+import (
+	"io"
+	"testing"
+
+	"github.com/cloudcube/database/graph/driver"
+)
+
+// queryFakeConn implements driver.Conn without driver.Queryer/driver.Execer,
+// so DB.Query/DB.Exec must fall back to Prepare->Query/Exec->Close.
+type queryFakeConn struct {
+	fakeConn
+	prepared int
+	stmt     *queryFakeStmt //most recently prepared statement
+}
+
+func (c *queryFakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.prepared++
+	c.stmt = &queryFakeStmt{}
+	return c.stmt, nil
+}
+
+type queryFakeStmt struct {
+	closed bool
+}
+
+func (s *queryFakeStmt) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *queryFakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return queryFakeResult{}, nil
+}
+
+func (s *queryFakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &queryFakeRows{cols: []string{"n"}}, nil
+}
+
+type queryFakeResult struct{}
+
+func (queryFakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (queryFakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type queryFakeRows struct {
+	cols   []string
+	served bool
+	closed bool
+}
+
+func (r *queryFakeRows) Columns() []string { return r.cols }
+func (r *queryFakeRows) Close() error {
+	r.closed = true
+	return nil
+}
+func (r *queryFakeRows) Next(dest []driver.Value) error {
+	if r.served {
+		return io.EOF
+	}
+	r.served = true
+	dest[0] = "ok"
+	return nil
+}
+
+func newTestDB(ci driver.Conn) (*DB, *driverConn) {
+	db := &DB{lastPut: make(map[*driverConn]string)}
+	dc := &driverConn{db: db, ci: ci}
+	db.addDep(dc, dc)
+	dc.inUse = true
+	return db, dc
+}
+
+// TestQueryFallsBackToPrepareQueryClose verifies that DB.Query,against
+// a driver with no Queryer fast path,prepares the statement,runs it,
+// and closes the statement once the resulting Rows is drained.
+func TestQueryFallsBackToPrepareQueryClose(t *testing.T) {
+	fc := &queryFakeConn{}
+	db, dc := newTestDB(fc)
+
+	rows, err := db.queryDC(dc, "MATCH (n) RETURN n", nil)
+	if err != nil {
+		t.Fatalf("queryDC: %v", err)
+	}
+	if fc.prepared != 1 {
+		t.Fatalf("expected Prepare to be called once,got %d", fc.prepared)
+	}
+
+	dest := make([]driver.Value, 1)
+	if err := rows.Next(dest); err != nil {
+		t.Fatalf("rows.Next: %v", err)
+	}
+	if dest[0] != "ok" {
+		t.Fatalf("unexpected row value %v", dest[0])
+	}
+	if err := rows.Next(dest); err != io.EOF {
+		t.Fatalf("expected io.EOF,got %v", err)
+	}
+	if !fc.stmt.closed {
+		t.Fatalf("expected the prepared statement to be closed once the Rows drained")
+	}
+
+	if err := rows.Close(); err != nil {
+		t.Fatalf("rows.Close: %v", err)
+	}
+	if dc.inUse {
+		t.Fatalf("expected Rows.Close to release dc back to the pool")
+	}
+}
+
+// TestExecFallsBackToPrepareExecClose verifies that DB.Exec,against a
+// driver with no Execer fast path,prepares the statement,executes it,
+// and closes the statement immediately.
+func TestExecFallsBackToPrepareExecClose(t *testing.T) {
+	fc := &queryFakeConn{}
+	db, dc := newTestDB(fc)
+	_ = db
+
+	res, err := db.execDC(dc, "CREATE (n)", nil)
+	if err != nil {
+		t.Fatalf("execDC: %v", err)
+	}
+	if fc.prepared != 1 {
+		t.Fatalf("expected Prepare to be called once,got %d", fc.prepared)
+	}
+	if !fc.stmt.closed {
+		t.Fatalf("expected the prepared statement to be closed after Exec")
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n != 1 {
+		t.Fatalf("unexpected RowsAffected: %v,%v", n, err)
+	}
+}
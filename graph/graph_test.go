@@ -0,0 +1,109 @@
+package graph
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cloudcube/database/graph/driver"
+)
+
+type fakeConn struct {
+	closed bool
+}
+
+func (c *fakeConn) CreateNode() (driver.Node, error) { return nil, errors.New("fakeConn: not implemented") }
+func (c *fakeConn) Node() (driver.Node, error)        { return nil, errors.New("fakeConn: not implemented") }
+func (c *fakeConn) CreateRelationship() (driver.Relationship, error) {
+	return nil, errors.New("fakeConn: not implemented")
+}
+func (c *fakeConn) RelationshipTypes() ([]string, error) { return nil, nil }
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeConn: not implemented")
+}
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+type fakeStmt struct {
+	closed bool
+}
+
+func (s *fakeStmt) Close() error {
+	s.closed = true
+	return nil
+}
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("fakeStmt: not implemented")
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("fakeStmt: not implemented")
+}
+
+// TestStmtCloseDefersConnCloseWhileRowsOpen verifies that closing a
+// Stmt does not let its underlying driver.Conn finalize while a Rows
+// obtained on the same connection is still open,and that the conn is
+// only actually closed once the Rows is closed.
+func TestStmtCloseDefersConnCloseWhileRowsOpen(t *testing.T) {
+	db := &DB{lastPut: make(map[*driverConn]string)}
+	fc := &fakeConn{}
+	dc := &driverConn{db: db, ci: fc, inUse: true}
+	db.addDep(dc, dc)
+
+	si := &fakeStmt{}
+	stmt := db.newStmt(dc, "MATCH (n) RETURN n", si)
+	rows := db.newRows(dc)
+
+	if err := stmt.Close(); err != nil {
+		t.Fatalf("stmt.Close: %v", err)
+	}
+	if !si.closed {
+		t.Fatalf("expected underlying driver.Stmt to be closed by Stmt.Close")
+	}
+
+	if err := dc.Close(); err != nil {
+		t.Fatalf("dc.Close: %v", err)
+	}
+	if fc.closed {
+		t.Fatalf("driver.Conn was closed while a Rows on it is still open")
+	}
+
+	if err := rows.Close(); err != nil {
+		t.Fatalf("rows.Close: %v", err)
+	}
+	if !fc.closed {
+		t.Fatalf("expected driver.Conn to close once the Rows dependent released it")
+	}
+}
+
+// TestStmtCloseKeepsConnOutOfPoolWhileRowsOpen verifies that Stmt.Close
+// does not return its connection to the pool while a Rows obtained via
+// Stmt.Query is still open,so another caller can't be handed the same
+// driver.Conn while the Rows is still reading from it.
+func TestStmtCloseKeepsConnOutOfPoolWhileRowsOpen(t *testing.T) {
+	db := &DB{lastPut: make(map[*driverConn]string), connRequests: make(map[uint64]chan connRequest)}
+	fc := &fakeConn{}
+	dc := &driverConn{db: db, ci: fc, inUse: true}
+	db.addDep(dc, dc)
+
+	stmt := db.newStmt(dc, "MATCH (n) RETURN n", &queryFakeStmt{})
+
+	rows, err := stmt.Query(nil)
+	if err != nil {
+		t.Fatalf("stmt.Query: %v", err)
+	}
+
+	if err := stmt.Close(); err != nil {
+		t.Fatalf("stmt.Close: %v", err)
+	}
+	if len(db.freeConn) != 0 {
+		t.Fatalf("expected dc to stay out of the pool while rows is still open,got %d free conns", len(db.freeConn))
+	}
+
+	if err := rows.Close(); err != nil {
+		t.Fatalf("rows.Close: %v", err)
+	}
+	if len(db.freeConn) != 1 {
+		t.Fatalf("expected dc to return to the pool once rows closed,got %d free conns", len(db.freeConn))
+	}
+}